@@ -4,42 +4,25 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"github.com/RoomOfRequirement/deepzoom/thumbnailer"
 	"github.com/disintegration/imaging"
 	"github.com/fogleman/gg"
-	"github.com/nfnt/resize"
 	"image"
-	"image/jpeg"
+	"image/color"
+	"image/png"
 	"math"
 	"os"
 	"path"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 )
 
 const DZITemplate = `<?xml version="1.0" ?><Image Format="{{.Format}}" Overlap="{{.Overlap}}" TileSize="{{.TileSize}}" xmlns="http://schemas.microsoft.com/deepzoom/2008"><Size Height="{{.Height}}" Width="{{.Width}}"/></Image>`
 
-var RESIZE_FILTERS = map[string]resize.InterpolationFunction{
-	"bilinear": resize.Bilinear,
-	"bicubic":  resize.Bicubic,
-	"nearest":  resize.NearestNeighbor,
-	"lanczos":  resize.Lanczos3,
-}
-
-func obtainFilter(filter string) string {
-	b := false
-	for k := range RESIZE_FILTERS {
-		if filter == k {
-			b = true
-		}
-	}
-	if b == false {
-		filter = "nearest"
-	}
-	return filter
-}
-
 func loadImage(filePath, format string) (image.Image, error) {
 	if format == "" || format == "jpg" {
 		return gg.LoadJPG(filePath)
@@ -153,8 +136,34 @@ type ImageCreator struct {
 	dzid         *DeepZoomImageDescriptor
 	Image        image.Image
 	ImageQuality float64
-	ResizeFilter string
 	CopyMetadata bool
+	// Parallelism is the number of tiles encoded concurrently. Defaults to
+	// runtime.NumCPU() when left at zero.
+	Parallelism int
+	// Progress, when set, is called after every tile of a level is written
+	// or skipped, with the number of tiles done and the level's total tile
+	// count. Parallelism and Progress apply to the in-memory path only; the
+	// streaming path of NewFromTiledSource writes tiles one at a time and
+	// does not call Progress.
+	Progress func(level, tilesDone, tilesTotal int)
+	// WebPQuality and WebPLossless configure the WebP encoder used when
+	// dzid.Format is "webp". WebPQuality is in the same 0-1 range as
+	// ImageQuality.
+	WebPQuality  float64
+	WebPLossless bool
+	// PNGCompression configures the PNG encoder used when dzid.Format is
+	// "png". The zero value is png.DefaultCompression.
+	PNGCompression png.CompressionLevel
+	// streamingSource is set by NewFromTiledSource, routing create through
+	// createStreaming instead of the in-memory path.
+	streamingSource TiledSource
+	// SkipUniformTiles, when set, skips writing tiles that are a single
+	// solid color matching BackgroundColor, or fully transparent, and
+	// records which tiles were written in a "<destination>_tiles.json"
+	// sidecar. A viewer can fall back to BackgroundColor for tiles missing
+	// from that manifest.
+	SkipUniformTiles bool
+	BackgroundColor  color.Color
 }
 
 func (ic *ImageCreator) getImage(level int) image.Image {
@@ -163,51 +172,147 @@ func (ic *ImageCreator) getImage(level int) image.Image {
 	if ic.dzid.Width == width && ic.dzid.Height == height {
 		return ic.Image
 	}
-	filter := obtainFilter(ic.ResizeFilter)
-	return resize.Thumbnail(uint(width), uint(height), ic.Image, RESIZE_FILTERS[filter])
+	img, err := thumbnailer.Generate(ic.Image, width, height, thumbnailer.MethodScale)
+	check(err)
+	return img
 }
 
-// Creates Deep Zoom image from source file
-func (ic *ImageCreator) New(source, format string, tileSize, overlap int) *ImageCreator {
-	img, err := loadImage(source, format)
+// Creates Deep Zoom image from source file. sourceFormat is the format of
+// source ("jpg" or "png"); tileFormat is the format tiles are encoded in
+// ("jpg", "png" or "webp") and may differ from sourceFormat.
+func (ic *ImageCreator) New(source, sourceFormat, tileFormat string, tileSize, overlap int) *ImageCreator {
+	img, err := loadImage(source, sourceFormat)
 	check(err)
 	ic.Image = img
 	width, height := img.Bounds().Dx(), img.Bounds().Dy()
-	ic.dzid = &DeepZoomImageDescriptor{Width: width, Height: height, TileSize: tileSize, Overlap: overlap, Format: format}
+	ic.dzid = &DeepZoomImageDescriptor{Width: width, Height: height, TileSize: tileSize, Overlap: overlap, Format: tileFormat}
 	return ic
 }
 
-func (ic *ImageCreator) create(destination string) {
+// limitGroup runs tasks concurrently, bounding how many run at once so that
+// memory usage (e.g. one decoded tile per in-flight task) stays predictable.
+type limitGroup struct {
+	sem  chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs []error
+}
+
+func newLimitGroup(limit int) *limitGroup {
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
+	return &limitGroup{sem: make(chan struct{}, limit)}
+}
+
+func (lg *limitGroup) run(task func() error) {
+	lg.sem <- struct{}{}
+	lg.wg.Add(1)
+	go func() {
+		defer lg.wg.Done()
+		defer func() { <-lg.sem }()
+		if err := task(); err != nil {
+			lg.mu.Lock()
+			lg.errs = append(lg.errs, err)
+			lg.mu.Unlock()
+		}
+	}()
+}
+
+func (lg *limitGroup) wait() error {
+	lg.wg.Wait()
+	if len(lg.errs) > 0 {
+		return lg.errs[0]
+	}
+	return nil
+}
+
+// writeTile encodes tile with encoder and writes it to levelDir/column_row.ext.
+func writeTile(levelDir string, column, row int, tile image.Image, encoder TileEncoder) error {
+	tilePath := path.Join(levelDir, fmt.Sprintf("%d_%d.%s", column, row, encoder.Extension()))
+	out, err := os.Create(tilePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return encoder.Encode(out, tile)
+}
+
+func (ic *ImageCreator) create(destination string) error {
+	if ic.streamingSource != nil {
+		return ic.createStreaming(destination)
+	}
 	imageFiles := getOrCreatePath(getFilesPath(destination))
+	encoder, err := ic.newTileEncoder()
+	if err != nil {
+		return err
+	}
+	var manifest *tileManifest
+	if ic.SkipUniformTiles {
+		manifest = &tileManifest{}
+	}
 	for level := 0; level < ic.dzid.NumLevels(); level++ {
 		levelDir := getOrCreatePath(path.Join(imageFiles, strconv.Itoa(level)))
 		levelImage := ic.getImage(level)
 		columns, rows := ic.dzid.getNumTiles(level)
+		tilesTotal := columns * rows
+		tilesDone := 0
+		var doneMu sync.Mutex
+
+		lg := newLimitGroup(ic.Parallelism)
 		for column := 0; column < columns; column++ {
 			for row := 0; row < rows; row++ {
-				bounds := ic.dzid.getTileBounds(level, column, row)
-				tile := imaging.Crop(levelImage, bounds)
-				format := ic.dzid.Format
-				tilePath := path.Join(levelDir, fmt.Sprintf("%d_%d.%s", column, row, format))
-				out, err := os.Create(tilePath)
-				check(err)
-				err = jpeg.Encode(out, tile, &jpeg.Options{Quality: int(ic.ImageQuality * 100)})
-				check(err)
+				level, column, row := level, column, row
+				lg.run(func() error {
+					bounds := ic.dzid.getTileBounds(level, column, row)
+					tile := imaging.Crop(levelImage, bounds)
+					skip := manifest != nil && isSkippableTile(tile, ic.BackgroundColor)
+					if !skip {
+						if err := writeTile(levelDir, column, row, tile, encoder); err != nil {
+							return err
+						}
+						if manifest != nil {
+							manifest.add(level, column, row)
+						}
+					}
+					if ic.Progress != nil {
+						doneMu.Lock()
+						tilesDone++
+						done := tilesDone
+						doneMu.Unlock()
+						ic.Progress(level, done, tilesTotal)
+					}
+					return nil
+				})
 			}
 		}
+		if err := lg.wait(); err != nil {
+			return err
+		}
 	}
 	ic.dzid.save(destination)
+	if manifest != nil {
+		return manifest.save(destination)
+	}
+	return nil
 }
 
 var (
-	help         bool
-	version      bool
-	source       string
-	format       string
-	tileSize     int
-	overlap      int
-	imageQuality float64
-	destination  string
+	help           bool
+	version        bool
+	source         string
+	format         string
+	tileFormat     string
+	tileSize       int
+	overlap        int
+	imageQuality   float64
+	webpQuality    float64
+	webpLossless   bool
+	pngCompression int
+	destination    string
+	streaming      bool
+	skipUniform    bool
+	background     string
 )
 
 func init() {
@@ -215,15 +320,27 @@ func init() {
 	flag.BoolVar(&version, "v", false, "version info")
 	flag.StringVar(&source, "s", "", "source image file path")
 	flag.StringVar(&format, "f", "jpg", "source image format, it should be jpg or png")
+	flag.StringVar(&tileFormat, "tf", "jpg", "tile output format, it should be jpg, png or webp")
 	flag.IntVar(&tileSize, "t", 256, "tile size")
 	flag.IntVar(&overlap, "l", 0, "tile overlap")
-	flag.Float64Var(&imageQuality, "q", 0.8, "output image quality")
+	flag.Float64Var(&imageQuality, "q", 0.8, "output image quality (jpg)")
+	flag.Float64Var(&webpQuality, "wq", 0.8, "webp output quality, used when -tf=webp")
+	flag.BoolVar(&webpLossless, "wl", false, "encode webp tiles losslessly, used when -tf=webp")
+	flag.IntVar(&pngCompression, "pc", 0, "png compression level (-3..0), used when -tf=png")
 	flag.StringVar(&destination, "d", "", "destination of dzi file path")
+	flag.BoolVar(&streaming, "streaming", false, "tile source directly via a TiledSource instead of loading it fully into memory (source must be a jpg); build with -tags jpegturbo for real windowed decoding")
+	flag.BoolVar(&skipUniform, "skip-uniform", false, "skip writing tiles that are a single solid color matching -bg, or fully transparent, recording which tiles exist in a '<destination>_tiles.json' manifest")
+	flag.StringVar(&background, "bg", "", "background color as a hex RRGGBB or RRGGBBAA string, used with -skip-uniform")
 	flag.Usage = usage
 }
 
 // sample usage: deepzoom -s /home/harold/go_tests/deepzoom/test.jpg -d /home/harold/go_tests/deepzoom/test.dzi
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "mosaic" {
+		runMosaicCmd(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
 
 	if help {
@@ -235,10 +352,26 @@ func main() {
 		os.Exit(1)
 	} else {
 		start := time.Now()
-		creator := new(ImageCreator)
+		var creator *ImageCreator
+		if streaming {
+			src, err := NewFileTiledSource(source)
+			check(err)
+			creator = NewFromTiledSource(src, tileSize, overlap, tileFormat)
+		} else {
+			creator = new(ImageCreator)
+			creator.New(source, format, tileFormat, tileSize, overlap)
+		}
 		creator.ImageQuality = imageQuality
-		creator.New(source, format, tileSize, overlap)
-		creator.create(destination)
+		creator.WebPQuality = webpQuality
+		creator.WebPLossless = webpLossless
+		creator.PNGCompression = png.CompressionLevel(pngCompression)
+		creator.SkipUniformTiles = skipUniform
+		if background != "" {
+			bg, err := parseBackgroundColor(background)
+			check(err)
+			creator.BackgroundColor = bg
+		}
+		check(creator.create(destination))
 		fmt.Println("Successfully executed")
 		fmt.Println("time consumption: ", time.Now().Sub(start).Seconds())
 	}
@@ -248,7 +381,8 @@ func usage() {
 	_, _ = fmt.Fprintf(os.Stderr, `Deepzoom tool in golang to generate dzi files
 Version: 0.0.1
 
-Usage: deepzoom [-hvsftld] [-h help] [-v version] [-s source image file path] [-f source image format(jpg or png)] [-t tile size] [-l tile overlap] [-q output image quality] [-d destination of dzi file path]
+Usage: deepzoom [-hvsftld] [-h help] [-v version] [-s source image file path] [-f source image format(jpg or png)] [-tf tile output format(jpg, png or webp)] [-t tile size] [-l tile overlap] [-q output image quality] [-d destination of dzi file path] [-streaming tile directly from a TiledSource instead of loading the source fully into memory] [-skip-uniform skip writing solid-color/transparent tiles] [-bg hex background color, used with -skip-uniform]
+       deepzoom mosaic [-frames dir] [-json manifest] [-i sample interval] [-c columns] [-t thumbnail size] [-q quality] [-o output path]
 
 Options
 `)
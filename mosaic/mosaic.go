@@ -0,0 +1,131 @@
+// Package mosaic builds a single composite image out of a sequence of
+// sampled frames, arranged as a grid of thumbnails.
+package mosaic
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"github.com/nfnt/resize"
+)
+
+// FrameSource supplies one frame to be thumbnailed into a Mosaic. Callers
+// can back it with a file on disk, an io.Reader, or an already-decoded
+// image.Image.
+type FrameSource interface {
+	Image() (image.Image, error)
+}
+
+type fileFrameSource struct{ path string }
+
+// FromFile returns a FrameSource that decodes a JPEG file on demand.
+func FromFile(path string) FrameSource { return fileFrameSource{path} }
+
+func (f fileFrameSource) Image() (image.Image, error) { return gg.LoadJPG(f.path) }
+
+type readerFrameSource struct{ r io.Reader }
+
+// FromReader returns a FrameSource that decodes a JPEG read from r.
+func FromReader(r io.Reader) FrameSource { return readerFrameSource{r} }
+
+func (f readerFrameSource) Image() (image.Image, error) { return jpeg.Decode(f.r) }
+
+type imageFrameSource struct{ img image.Image }
+
+// FromImage returns a FrameSource wrapping an already-decoded image.
+func FromImage(img image.Image) FrameSource { return imageFrameSource{img} }
+
+func (f imageFrameSource) Image() (image.Image, error) { return f.img, nil }
+
+// Mosaic arranges sampled frames into a grid of thumbnails.
+type Mosaic struct {
+	ThumbnailSize  uint
+	Columns        int
+	SampleInterval int
+	Parallelism    int
+	Filter         resize.InterpolationFunction
+}
+
+type positionedThumbnail struct {
+	img         image.Image
+	row, column int
+}
+
+// Build samples every SampleInterval-th frame, thumbnails each to
+// ThumbnailSize and composites them into a single image with Columns
+// columns, in the order they were sampled.
+func (m *Mosaic) Build(frames []FrameSource) (image.Image, error) {
+	interval := m.SampleInterval
+	if interval <= 0 {
+		interval = 1
+	}
+	if m.Columns <= 0 {
+		return nil, errors.New("mosaic: Columns must be positive")
+	}
+
+	var sampled []FrameSource
+	for i := 0; i <= len(frames)-interval; i += interval {
+		sampled = append(sampled, frames[i])
+	}
+	if len(sampled) == 0 {
+		return nil, errors.New("mosaic: no frames sampled")
+	}
+
+	// resize.NearestNeighbor is the zero value of InterpolationFunction, so
+	// an unset Filter already defaults to it without any extra check.
+	filter := m.Filter
+	parallelism := m.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+
+	thumbs := make([]positionedThumbnail, len(sampled))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for i, frame := range sampled {
+		i, frame := i, frame
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			img, err := frame.Image()
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+			thumb := resize.Thumbnail(m.ThumbnailSize, m.ThumbnailSize, img, filter)
+			thumbs[i] = positionedThumbnail{img: thumb, row: i / m.Columns, column: i % m.Columns}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	thumbnailWidth, thumbnailHeight := thumbs[0].img.Bounds().Dx(), thumbs[0].img.Bounds().Dy()
+	rows := (len(sampled)-1)/m.Columns + 1
+	canvas := image.NewRGBA(image.Rectangle{Max: image.Point{
+		X: thumbnailWidth * m.Columns,
+		Y: thumbnailHeight * rows,
+	}})
+	for _, t := range thumbs {
+		origin := image.Point{X: t.column * thumbnailWidth, Y: t.row * thumbnailHeight}
+		rect := image.Rectangle{Min: origin, Max: origin.Add(t.img.Bounds().Size())}
+		draw.Draw(canvas, rect, t.img, image.Point{}, draw.Src)
+	}
+	return canvas, nil
+}
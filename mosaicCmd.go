@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image/jpeg"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/RoomOfRequirement/deepzoom/mosaic"
+)
+
+// mosaicJsonData describes the frame sequence a `deepzoom mosaic` run reads:
+// timestamps name the numbered JPEG frames to sample from, e.g. "0.jpeg".
+type mosaicJsonData struct {
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Format   string `json:"format"`
+	FrameNum []int  `json:"timestamps"`
+}
+
+func getMosaicJsonData(filePath string) (mosaicJsonData, error) {
+	var data mosaicJsonData
+	raw, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return data, err
+	}
+	err = json.Unmarshal(raw, &data)
+	return data, err
+}
+
+// runMosaicCmd implements `deepzoom mosaic`, building a thumbnail-grid
+// composite from the numbered frames listed in a json manifest.
+func runMosaicCmd(args []string) {
+	fs := flag.NewFlagSet("mosaic", flag.ExitOnError)
+	framesDir := fs.String("frames", "", "directory of numbered frame JPEGs, e.g. 0.jpeg, 1.jpeg, ...")
+	jsonPath := fs.String("json", "", "json manifest listing frame timestamps")
+	sampleInterval := fs.Int("i", 20, "sample every Nth frame")
+	columns := fs.Int("c", 25, "number of columns in the mosaic grid")
+	thumbnailSize := fs.Uint("t", 100, "thumbnail size")
+	parallelism := fs.Int("p", 0, "max concurrent thumbnail generations, defaults to NumCPU")
+	quality := fs.Int("q", 75, "output jpeg quality")
+	out := fs.String("o", "mosaic.jpg", "output jpeg path")
+	fs.Parse(args)
+
+	if *framesDir == "" || *jsonPath == "" {
+		fmt.Println("too few arguments, 'mosaic' needs -frames and -json, use '-h' to see help info")
+		os.Exit(1)
+	}
+
+	data, err := getMosaicJsonData(*jsonPath)
+	check(err)
+
+	frames := make([]mosaic.FrameSource, len(data.FrameNum))
+	for i, n := range data.FrameNum {
+		frames[i] = mosaic.FromFile(path.Join(*framesDir, strconv.Itoa(n)+".jpeg"))
+	}
+
+	m := &mosaic.Mosaic{
+		ThumbnailSize:  *thumbnailSize,
+		Columns:        *columns,
+		SampleInterval: *sampleInterval,
+		Parallelism:    *parallelism,
+	}
+	img, err := m.Build(frames)
+	check(err)
+
+	outFile, err := os.Create(*out)
+	check(err)
+	defer outFile.Close()
+	check(jpeg.Encode(outFile, img, &jpeg.Options{Quality: *quality}))
+
+	fmt.Println("Successfully executed")
+}
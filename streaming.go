@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/RoomOfRequirement/deepzoom/thumbnailer"
+)
+
+// TiledSource provides windowed access to a source image that may be too
+// large to decode fully into memory. Only the pixels asked for in Region
+// need to be materialized at once.
+type TiledSource interface {
+	// Bounds returns the full pixel bounds of the source image.
+	Bounds() image.Rectangle
+	// Region returns the pixels inside r.
+	Region(r image.Rectangle) (image.Image, error)
+	Close() error
+}
+
+// fileTiledSource is the default, pure-Go TiledSource backed by a JPEG
+// file on disk. The standard library's image/jpeg has no partial-decode
+// API, so it still has to decode the whole file upfront on open; build
+// with `-tags jpegturbo` for a real windowed, row-band decoder
+// (turboTiledSource in streaming_jpegturbo.go) that never holds the full
+// image in memory.
+type fileTiledSource struct {
+	file *os.File
+	img  image.Image
+}
+
+// newFileTiledSourceImpl is swapped out by streaming_jpegturbo.go's init
+// when built with the "jpegturbo" tag.
+var newFileTiledSourceImpl = func(filePath string) (TiledSource, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileTiledSource{file: f, img: img}, nil
+}
+
+// NewFileTiledSource opens filePath as a streaming TiledSource.
+func NewFileTiledSource(filePath string) (TiledSource, error) {
+	return newFileTiledSourceImpl(filePath)
+}
+
+func (s *fileTiledSource) Bounds() image.Rectangle { return s.img.Bounds() }
+
+func (s *fileTiledSource) Region(r image.Rectangle) (image.Image, error) {
+	r = r.Intersect(s.img.Bounds())
+	band := image.NewRGBA(image.Rectangle{Max: r.Size()})
+	draw.Draw(band, band.Bounds(), s.img, r.Min, draw.Src)
+	return band, nil
+}
+
+func (s *fileTiledSource) Close() error { return s.file.Close() }
+
+// NewFromTiledSource builds an ImageCreator whose create writes the
+// pyramid bottom-up from src instead of resizing the whole source image
+// per level, so gigapixel inputs don't need to fit in memory at once.
+func NewFromTiledSource(src TiledSource, tileSize, overlap int, format string) *ImageCreator {
+	bounds := src.Bounds()
+	ic := new(ImageCreator)
+	ic.dzid = &DeepZoomImageDescriptor{
+		Width: bounds.Dx(), Height: bounds.Dy(),
+		TileSize: tileSize, Overlap: overlap, Format: format,
+	}
+	ic.streamingSource = src
+	return ic
+}
+
+// createStreaming tiles the finest level directly from ic.streamingSource,
+// then builds each coarser level by averaging 2x2 blocks of the tiles just
+// written for the level below. At any point only one level's tiles, plus
+// whatever ic.streamingSource.Region materializes, need to be resident.
+func (ic *ImageCreator) createStreaming(destination string) error {
+	imageFiles := getOrCreatePath(getFilesPath(destination))
+	encoder, err := ic.newTileEncoder()
+	if err != nil {
+		return err
+	}
+	finestLevel := ic.dzid.NumLevels() - 1
+
+	var manifest *tileManifest
+	if ic.SkipUniformTiles {
+		manifest = &tileManifest{}
+	}
+
+	levelDir := getOrCreatePath(path.Join(imageFiles, strconv.Itoa(finestLevel)))
+	columns, rows := ic.dzid.getNumTiles(finestLevel)
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			bounds := ic.dzid.getTileBounds(finestLevel, column, row)
+			tile, err := ic.streamingSource.Region(bounds)
+			if err != nil {
+				return err
+			}
+			if manifest != nil && isSkippableTile(tile, ic.BackgroundColor) {
+				continue
+			}
+			if err := writeTile(levelDir, column, row, tile, encoder); err != nil {
+				return err
+			}
+			if manifest != nil {
+				manifest.add(finestLevel, column, row)
+			}
+		}
+	}
+	if err := ic.streamingSource.Close(); err != nil {
+		return err
+	}
+
+	for level := finestLevel - 1; level >= 0; level-- {
+		levelDir := getOrCreatePath(path.Join(imageFiles, strconv.Itoa(level)))
+		childDir := path.Join(imageFiles, strconv.Itoa(level+1))
+		columns, rows := ic.dzid.getNumTiles(level)
+		childColumns, childRows := ic.dzid.getNumTiles(level + 1)
+		// Only finest-level tiles carry overlap padding; the tiles written
+		// here by averageChildTiles do not.
+		childOverlap := 0
+		if level+1 == finestLevel {
+			childOverlap = ic.dzid.Overlap
+		}
+		for row := 0; row < rows; row++ {
+			for column := 0; column < columns; column++ {
+				tile, err := averageChildTiles(childDir, column, row, ic.dzid.TileSize, childOverlap, childColumns, childRows, encoder.Extension(), ic.BackgroundColor)
+				if err != nil {
+					return err
+				}
+				if manifest != nil && isSkippableTile(tile, ic.BackgroundColor) {
+					continue
+				}
+				if err := writeTile(levelDir, column, row, tile, encoder); err != nil {
+					return err
+				}
+				if manifest != nil {
+					manifest.add(level, column, row)
+				}
+			}
+		}
+	}
+
+	ic.dzid.save(destination)
+	if manifest != nil {
+		return manifest.save(destination)
+	}
+	return nil
+}
+
+// averageChildTiles downscales the 2x2 block of finer-level tiles beneath
+// (column, row) into one coarser-level tile. Children past the edge of the
+// pyramid (outside the childColumns x childRows grid, as the level below
+// doesn't evenly divide by two) are left blank. A child inside that grid
+// with no file on disk was skipped by SkipUniformTiles; its quadrant is
+// filled with background, or left blank when background is nil.
+// Per getTileBounds, a finest-level child tile is padded with up to overlap
+// pixels on each side that isn't on the image edge, so each child is cropped
+// back to its tileSize x tileSize core before being placed in the 2x2
+// canvas; overlap is 0 for children that carry no padding.
+func averageChildTiles(childDir string, column, row, tileSize, overlap, childColumns, childRows int, ext string, background color.Color) (image.Image, error) {
+	canvas := image.NewRGBA(image.Rectangle{Max: image.Point{X: tileSize * 2, Y: tileSize * 2}})
+	for dy := 0; dy < 2; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			childColumn, childRow := column*2+dx, row*2+dy
+			childPath := path.Join(childDir, fmt.Sprintf("%d_%d.%s", childColumn, childRow, ext))
+			child, err := decodeTile(childPath)
+			if err != nil {
+				if os.IsNotExist(err) {
+					if background != nil && childColumn < childColumns && childRow < childRows {
+						quadrant := image.Rect(dx*tileSize, dy*tileSize, (dx+1)*tileSize, (dy+1)*tileSize)
+						draw.Draw(canvas, quadrant, image.NewUniform(background), image.Point{}, draw.Src)
+					}
+					continue
+				}
+				return nil, err
+			}
+			offsetX, offsetY := 0, 0
+			if childColumn != 0 {
+				offsetX = overlap
+			}
+			if childRow != 0 {
+				offsetY = overlap
+			}
+			core := image.Rectangle{Min: image.Point{X: offsetX, Y: offsetY}, Max: image.Point{X: offsetX + tileSize, Y: offsetY + tileSize}}
+			core = core.Intersect(child.Bounds())
+			origin := image.Point{X: dx * tileSize, Y: dy * tileSize}
+			draw.Draw(canvas, image.Rectangle{Min: origin, Max: origin.Add(core.Size())}, child, core.Min, draw.Src)
+		}
+	}
+	return thumbnailer.Generate(canvas, tileSize, tileSize, thumbnailer.MethodScale)
+}
+
+// decodeTile opens and decodes a previously written tile, dispatching on
+// whichever image format is registered for its extension (jpeg and png are
+// registered by this package's imports; webp only in builds with the webp
+// tag, the only builds that write webp tiles).
+func decodeTile(tilePath string) (image.Image, error) {
+	f, err := os.Open(tilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
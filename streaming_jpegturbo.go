@@ -0,0 +1,217 @@
+//go:build jpegturbo
+
+package main
+
+/*
+#cgo LDFLAGS: -ljpeg
+#include <stdlib.h>
+#include <stdio.h>
+#include <jpeglib.h>
+#include <setjmp.h>
+
+struct turboErrorMgr {
+	struct jpeg_error_mgr pub;
+	jmp_buf jmp;
+};
+
+static void turboErrorExit(j_common_ptr cinfo) {
+	struct turboErrorMgr *mgr = (struct turboErrorMgr *)cinfo->err;
+	longjmp(mgr->jmp, 1);
+}
+
+// turboNew allocates a jpeg_decompress_struct and its error manager as
+// plain C memory (never Go-managed), since libjpeg stores a self-pointer
+// from cinfo->err back to the error manager for the life of the session -
+// exactly the kind of cross-call pointer cgo forbids pointing at Go memory.
+static struct jpeg_decompress_struct *turboNew(void) {
+	struct jpeg_decompress_struct *cinfo = calloc(1, sizeof(*cinfo));
+	struct turboErrorMgr *mgr = calloc(1, sizeof(*mgr));
+	if (!cinfo || !mgr) {
+		free(cinfo);
+		free(mgr);
+		return NULL;
+	}
+	jpeg_std_error(&mgr->pub);
+	mgr->pub.error_exit = turboErrorExit;
+	cinfo->err = &mgr->pub;
+	jpeg_create_decompress(cinfo);
+	return cinfo;
+}
+
+// turboOpen reads the header and starts decompression, all under one
+// setjmp so a libjpeg fatal error longjmps back here instead of aborting
+// the process. Returns 0 on success, -1 on a libjpeg error.
+static int turboOpen(struct jpeg_decompress_struct *cinfo, FILE *f) {
+	struct turboErrorMgr *mgr = (struct turboErrorMgr *)cinfo->err;
+	if (setjmp(mgr->jmp)) {
+		return -1;
+	}
+	jpeg_stdio_src(cinfo, f);
+	jpeg_read_header(cinfo, TRUE);
+	jpeg_start_decompress(cinfo);
+	return 0;
+}
+
+// turboReadBand skips forward `skip` scanlines then decodes `rows` more
+// into buf (stride bytes per row), under the same setjmp-guarded pattern.
+static int turboReadBand(struct jpeg_decompress_struct *cinfo, unsigned char *buf, int stride, int skip, int rows) {
+	struct turboErrorMgr *mgr = (struct turboErrorMgr *)cinfo->err;
+	if (setjmp(mgr->jmp)) {
+		return -1;
+	}
+	if (skip > 0) {
+		jpeg_skip_scanlines(cinfo, (JDIMENSION)skip);
+	}
+	for (int row = 0; row < rows; row++) {
+		JSAMPROW rowPtr = (JSAMPROW)(buf + (size_t)row * stride);
+		jpeg_read_scanlines(cinfo, &rowPtr, 1);
+	}
+	return 0;
+}
+
+static void turboDestroy(struct jpeg_decompress_struct *cinfo) {
+	void *err = cinfo->err;
+	jpeg_destroy_decompress(cinfo);
+	free(err);
+	free(cinfo);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"os"
+	"unsafe"
+)
+
+// turboTiledSource is a TiledSource backed directly by libjpeg-turbo. It
+// keeps one open decompress session and reads scanlines strictly forward,
+// so Region only ever materializes the row-band it was asked for rather
+// than the whole source image. This matches createStreaming's row-major
+// tile order, where every tile in a row shares the same Y range (derived
+// only from the row index) and asks for it once per column: Region caches
+// the last decoded band and crops columns from it instead of re-decoding,
+// only advancing the decoder when a genuinely new Y range is requested.
+// A new Y range must start at or after the end of the last decoded band, so
+// overlapping row bands (a nonzero tile overlap) make Region return an error.
+type turboTiledSource struct {
+	file         *os.File
+	cFile        *C.FILE
+	cinfo        *C.struct_jpeg_decompress_struct
+	width        int
+	height       int
+	components   int
+	nextScanline int
+
+	bandMin int
+	bandMax int
+	bandPix []byte // RGBA, full width, rows bandMax-bandMin
+}
+
+// NewTurboFileTiledSource opens filePath as a row-band streaming
+// TiledSource using libjpeg-turbo. Only built with `-tags jpegturbo`,
+// which requires cgo and libjpeg-turbo's headers.
+func NewTurboFileTiledSource(filePath string) (TiledSource, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	cPath := C.CString(filePath)
+	defer C.free(unsafe.Pointer(cPath))
+	cMode := C.CString("rb")
+	defer C.free(unsafe.Pointer(cMode))
+	cFile, cerr := C.fopen(cPath, cMode)
+	if cFile == nil {
+		f.Close()
+		return nil, cerr
+	}
+
+	cinfo := C.turboNew()
+	if cinfo == nil {
+		f.Close()
+		C.fclose(cFile)
+		return nil, errors.New("streaming: libjpeg allocation failed")
+	}
+
+	s := &turboTiledSource{file: f, cFile: cFile, cinfo: cinfo}
+	if C.turboOpen(s.cinfo, s.cFile) != 0 {
+		s.Close()
+		return nil, errors.New("streaming: libjpeg failed to open " + filePath)
+	}
+	s.width = int(s.cinfo.output_width)
+	s.height = int(s.cinfo.output_height)
+	s.components = int(s.cinfo.output_components)
+	return s, nil
+}
+
+func (s *turboTiledSource) Bounds() image.Rectangle {
+	return image.Rect(0, 0, s.width, s.height)
+}
+
+func (s *turboTiledSource) Region(r image.Rectangle) (image.Image, error) {
+	r = r.Intersect(s.Bounds())
+	if r.Empty() {
+		return nil, errors.New("streaming: empty region")
+	}
+
+	if s.bandPix == nil || r.Min.Y != s.bandMin || r.Max.Y != s.bandMax {
+		if r.Min.Y < s.nextScanline {
+			return nil, errors.New("streaming: turboTiledSource requires each row band to start at or after the end of the previous one")
+		}
+		stride := s.width * s.components
+		band := make([]byte, r.Dy()*stride)
+		skip := r.Min.Y - s.nextScanline
+		if C.turboReadBand(s.cinfo, (*C.uchar)(unsafe.Pointer(&band[0])), C.int(stride), C.int(skip), C.int(r.Dy())) != 0 {
+			return nil, errors.New("streaming: libjpeg decode error")
+		}
+		s.nextScanline = r.Max.Y
+		s.bandMin, s.bandMax = r.Min.Y, r.Max.Y
+		s.bandPix = rgbToRGBA(band, stride, r.Dy(), s.components)
+	}
+
+	full := &image.RGBA{
+		Pix:    s.bandPix,
+		Stride: s.width * 4,
+		Rect:   image.Rect(0, 0, s.width, r.Dy()),
+	}
+	return full.SubImage(image.Rect(r.Min.X, 0, r.Max.X, r.Dy())), nil
+}
+
+// rgbToRGBA expands libjpeg's packed 1 (gray) or 3 (RGB) byte-per-pixel
+// scanlines into RGBA, since image.RGBA is what the rest of the pipeline
+// (imaging.Crop, the TileEncoders) expects.
+func rgbToRGBA(pix []byte, stride, rows, components int) []byte {
+	width := stride / components
+	out := make([]byte, width*rows*4)
+	for y := 0; y < rows; y++ {
+		in := pix[y*stride : (y+1)*stride]
+		o := out[y*width*4 : (y+1)*width*4]
+		for x := 0; x < width; x++ {
+			switch components {
+			case 1:
+				g := in[x]
+				o[x*4], o[x*4+1], o[x*4+2], o[x*4+3] = g, g, g, 0xff
+			default:
+				o[x*4], o[x*4+1], o[x*4+2], o[x*4+3] = in[x*3], in[x*3+1], in[x*3+2], 0xff
+			}
+		}
+	}
+	return out
+}
+
+func (s *turboTiledSource) Close() error {
+	if s.cinfo != nil {
+		C.turboDestroy(s.cinfo)
+		s.cinfo = nil
+	}
+	if s.cFile != nil {
+		C.fclose(s.cFile)
+		s.cFile = nil
+	}
+	return s.file.Close()
+}
+
+func init() {
+	newFileTiledSourceImpl = NewTurboFileTiledSource
+}
@@ -0,0 +1,96 @@
+package thumbnailer
+
+import (
+	"errors"
+	"image"
+	"math"
+	"runtime"
+)
+
+// Size is one of the statically pre-generated thumbnail dimensions in a
+// Config.
+type Size struct {
+	Width, Height int
+}
+
+// Config describes the thumbnails a Limiter should be able to serve: a
+// static list of pre-generated sizes used as a fallback, and whether
+// dynamic (arbitrary-size, on-demand) requests are allowed at all.
+type Config struct {
+	Sizes   []Size
+	Method  Method
+	Dynamic bool
+	// MaxConcurrentDynamic bounds how many dynamic resize operations run at
+	// once; defaults to runtime.NumCPU() when zero.
+	MaxConcurrentDynamic int
+}
+
+// Limiter serves thumbnail requests through a bounded semaphore. When
+// Dynamic is enabled but the concurrency limit is currently exhausted (or
+// Dynamic is disabled altogether), it falls back to the nearest
+// pre-generated Size instead of making the caller wait.
+type Limiter struct {
+	cfg Config
+	sem chan struct{}
+}
+
+// NewLimiter builds a Limiter from cfg.
+func NewLimiter(cfg Config) *Limiter {
+	limit := cfg.MaxConcurrentDynamic
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
+	return &Limiter{cfg: cfg, sem: make(chan struct{}, limit)}
+}
+
+// Get returns a width x height thumbnail of src, generating it dynamically
+// when the concurrency limit allows, or the nearest configured Size
+// otherwise.
+func (l *Limiter) Get(src image.Image, width, height int) (image.Image, error) {
+	if l.cfg.Dynamic && width > 0 && height > 0 {
+		select {
+		case l.sem <- struct{}{}:
+			defer func() { <-l.sem }()
+			return Generate(src, width, height, l.cfg.Method)
+		default:
+		}
+	}
+	size, ok := nearestSize(l.cfg.Sizes, width, height)
+	if !ok {
+		return nil, errors.New("thumbnailer: no dynamic capacity and no fallback size configured")
+	}
+	return Generate(src, size.Width, size.Height, l.cfg.Method)
+}
+
+// nearestSize ranks sizes by aspect-ratio distance first, then area
+// distance, and returns the closest match to width x height. If width or
+// height is non-positive the whole request is treated as "any" via
+// math.Inf sentinels: no candidate's ratio or area is penalized, so the
+// first Size is returned.
+func nearestSize(sizes []Size, width, height int) (Size, bool) {
+	if len(sizes) == 0 {
+		return Size{}, false
+	}
+
+	wantRatio, wantArea := math.Inf(1), math.Inf(1)
+	if width > 0 && height > 0 {
+		wantRatio = float64(width) / float64(height)
+		wantArea = float64(width * height)
+	}
+
+	var best Size
+	bestRatioDist, bestAreaDist := math.Inf(1), math.Inf(1)
+	for i, s := range sizes {
+		ratioDist, areaDist := 0.0, 0.0
+		if !math.IsInf(wantRatio, 1) {
+			ratioDist = math.Abs(float64(s.Width)/float64(s.Height) - wantRatio)
+		}
+		if !math.IsInf(wantArea, 1) {
+			areaDist = math.Abs(float64(s.Width*s.Height) - wantArea)
+		}
+		if i == 0 || ratioDist < bestRatioDist || (ratioDist == bestRatioDist && areaDist < bestAreaDist) {
+			best, bestRatioDist, bestAreaDist = s, ratioDist, areaDist
+		}
+	}
+	return best, true
+}
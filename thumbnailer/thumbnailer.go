@@ -0,0 +1,41 @@
+// Package thumbnailer generates fixed-size thumbnails from an already
+// decoded image. It backs both on-demand thumbnail requests and the DZI
+// level-image resizing in the deepzoom generator, which share the same
+// resize/crop logic.
+package thumbnailer
+
+import (
+	"errors"
+	"image"
+
+	"github.com/disintegration/imaging"
+	"github.com/nfnt/resize"
+)
+
+// Method selects how Generate fits src into the requested dimensions.
+type Method int
+
+const (
+	// MethodScale resizes preserving aspect ratio; one dimension may end up
+	// smaller than requested.
+	MethodScale Method = iota
+	// MethodCrop resizes so the image fully covers width x height, then
+	// center-crops down to exactly that size.
+	MethodCrop
+)
+
+// Generate returns a thumbnail of src fitted to width x height using method:
+// exactly that size with MethodCrop, at most that size with MethodScale.
+func Generate(src image.Image, width, height int, method Method) (image.Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("thumbnailer: width and height must be positive")
+	}
+	switch method {
+	case MethodScale:
+		return resize.Thumbnail(uint(width), uint(height), src, resize.Lanczos3), nil
+	case MethodCrop:
+		return imaging.Fill(src, width, height, imaging.Center, imaging.Lanczos), nil
+	default:
+		return nil, errors.New("thumbnailer: unknown method")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// TileEncoder encodes a single pyramid tile to w and reports the file
+// extension tiles written by it should use.
+type TileEncoder interface {
+	Encode(w io.Writer, img image.Image) error
+	Extension() string
+}
+
+type jpegTileEncoder struct {
+	Quality int
+}
+
+func (e *jpegTileEncoder) Encode(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: e.Quality})
+}
+
+func (e *jpegTileEncoder) Extension() string { return "jpg" }
+
+type pngTileEncoder struct {
+	Compression png.CompressionLevel
+}
+
+func (e *pngTileEncoder) Encode(w io.Writer, img image.Image) error {
+	enc := png.Encoder{CompressionLevel: e.Compression}
+	return enc.Encode(w, img)
+}
+
+func (e *pngTileEncoder) Extension() string { return "png" }
+
+// newWebPTileEncoder is swapped out by tileEncoder_webp.go, built only with
+// the "webp" build tag, so the default build never pulls in chai2010/webp's
+// cgo libwebp bindings and stays CGO-free.
+var newWebPTileEncoder = func(ic *ImageCreator) (TileEncoder, error) {
+	return nil, errors.New("deepzoom: built without webp support, rebuild with -tags webp")
+}
+
+// newTileEncoder picks the TileEncoder matching ic.dzid.Format, falling back
+// to JPEG for anything else so existing callers keep working unchanged.
+func (ic *ImageCreator) newTileEncoder() (TileEncoder, error) {
+	switch ic.dzid.Format {
+	case "png":
+		return &pngTileEncoder{Compression: ic.PNGCompression}, nil
+	case "webp":
+		return newWebPTileEncoder(ic)
+	default:
+		return &jpegTileEncoder{Quality: int(ic.ImageQuality * 100)}, nil
+	}
+}
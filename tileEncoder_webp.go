@@ -0,0 +1,27 @@
+//go:build webp
+
+package main
+
+import (
+	"image"
+	"io"
+
+	"github.com/chai2010/webp"
+)
+
+type webpTileEncoder struct {
+	Quality  float32
+	Lossless bool
+}
+
+func (e *webpTileEncoder) Encode(w io.Writer, img image.Image) error {
+	return webp.Encode(w, img, &webp.Options{Lossless: e.Lossless, Quality: e.Quality})
+}
+
+func (e *webpTileEncoder) Extension() string { return "webp" }
+
+func init() {
+	newWebPTileEncoder = func(ic *ImageCreator) (TileEncoder, error) {
+		return &webpTileEncoder{Quality: float32(ic.WebPQuality * 100), Lossless: ic.WebPLossless}, nil
+	}
+}
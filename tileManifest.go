@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// tileManifestEntry records one written tile's position in the pyramid.
+type tileManifestEntry struct {
+	Level  int `json:"level"`
+	Column int `json:"column"`
+	Row    int `json:"row"`
+}
+
+// tileManifest collects, across concurrent tile writers, which tiles were
+// actually written to disk when SkipUniformTiles drops some of them.
+type tileManifest struct {
+	mu    sync.Mutex
+	Tiles []tileManifestEntry `json:"tiles"`
+}
+
+func (tm *tileManifest) add(level, column, row int) {
+	tm.mu.Lock()
+	tm.Tiles = append(tm.Tiles, tileManifestEntry{Level: level, Column: column, Row: row})
+	tm.mu.Unlock()
+}
+
+// getManifestPath mirrors getFilesPath's naming convention for the sidecar
+// listing which tiles exist.
+func getManifestPath(filePath string) string {
+	return strings.TrimSuffix(filePath, path.Ext(filePath)) + "_tiles.json"
+}
+
+func (tm *tileManifest) save(destination string) error {
+	out, err := os.Create(getManifestPath(destination))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return json.NewEncoder(out).Encode(tm)
+}
+
+// parseBackgroundColor parses a hex "RRGGBB" or "RRGGBBAA" string (as
+// accepted by the -bg flag) into a color.Color for use as BackgroundColor.
+func parseBackgroundColor(hex string) (color.Color, error) {
+	var r, g, b, a uint8
+	a = 0xff
+	switch len(hex) {
+	case 6:
+		if _, err := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b); err != nil {
+			return nil, fmt.Errorf("deepzoom: invalid -bg value %q: %w", hex, err)
+		}
+	case 8:
+		if _, err := fmt.Sscanf(hex, "%02x%02x%02x%02x", &r, &g, &b, &a); err != nil {
+			return nil, fmt.Errorf("deepzoom: invalid -bg value %q: %w", hex, err)
+		}
+	default:
+		return nil, fmt.Errorf("deepzoom: invalid -bg value %q: expected RRGGBB or RRGGBBAA", hex)
+	}
+	return color.NRGBA{R: r, G: g, B: b, A: a}, nil
+}
+
+// isSkippableTile reports whether tile is a single solid color that either
+// matches background or is fully transparent, meaning a viewer can render
+// it without the pyramid shipping the tile at all.
+func isSkippableTile(tile image.Image, background color.Color) bool {
+	bounds := tile.Bounds()
+	fr, fg, fb, fa := tile.At(bounds.Min.X, bounds.Min.Y).RGBA()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := tile.At(x, y).RGBA()
+			if r != fr || g != fg || b != fb || a != fa {
+				return false
+			}
+		}
+	}
+	if fa == 0 {
+		return true
+	}
+	if background == nil {
+		return false
+	}
+	br, bg, bb, ba := background.RGBA()
+	return fr == br && fg == bg && fb == bb && fa == ba
+}